@@ -1,3 +1,7 @@
+//go:build ignore
+
+// checkip1 为早期版本，独立于模块中的 checkip4 单独运行: go run checkip1.go
+
 package main
 
 import (
@@ -34,6 +38,10 @@ func checkConnectivity(info ServerInfo, timeout time.Duration, wg *sync.WaitGrou
 			results <- fmt.Sprintf("Server ID: %d, App Name: %s, IP: %s, Port: %d, get ip failed (Failed to resolve IP)", info.ServerID, info.AppName, info.ServerIP, info.ServerPort)
 			return
 		}
+		if len(ips) == 0 {
+			results <- fmt.Sprintf("Server ID: %d, App Name: %s, IP: %s, Port: %d, get ip failed (DNS返回空结果)", info.ServerID, info.AppName, info.ServerIP, info.ServerPort)
+			return
+		}
 		ip = ips[0].String()
 	}
 
@@ -83,7 +91,9 @@ func main() {
 	}
 
 	var wg sync.WaitGroup
-	results := make(chan string)
+	// 结果通道按服务器数量缓冲，每个检查协程发送结果时都不会阻塞，
+	// 即使日志写入较慢也不会反过来拖慢检查本身
+	results := make(chan string, len(serverInfos))
 
 	// 设置超时时间为5秒
 	timeout := 5 * time.Second
@@ -1,3 +1,7 @@
+//go:build ignore
+
+// checkip3 为早期版本，独立于模块中的 checkip4 单独运行: go run checkip3.go
+
 package main
 
 import (
@@ -0,0 +1,104 @@
+//go:build consul
+
+// 从 Consul 健康检查 API 获取服务器列表 (-consul-addr)，需以 -tags consul 编译
+
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	fetchConsulServices = consulServices
+}
+
+// consulEntry 为 Consul /v1/health/service 接口返回的一个服务实例
+type consulEntry struct {
+	Node struct {
+		Node    string
+		Address string
+	}
+	Service struct {
+		ID      string
+		Service string
+		Address string // 为空时使用节点地址
+		Port    int
+		Meta    map[string]string
+	}
+}
+
+// consulServices 从 Consul 获取 -consul-service 中各服务通过健康检查的实例
+// serverID 取自服务元数据 serverID，未设置时按服务名、节点、实例ID 排序后从 1 开始编号
+func consulServices(config Config) ([]ServerInfo, error) {
+	base := strings.TrimSuffix(config.ConsulAddr, "/")
+	if !isURLSource(base) {
+		base = "http://" + base
+	}
+	client := helperHTTPClient(config.FetchTimeout)
+
+	var entries []consulEntry
+	for _, service := range strings.Split(config.ConsulService, ",") {
+		service = strings.TrimSpace(service)
+		if service == "" {
+			continue
+		}
+		endpoint := base + "/v1/health/service/" + url.PathEscape(service) + "?passing=true"
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 Consul 地址 %s: %w", config.ConsulAddr, err)
+		}
+		if token := os.Getenv("CONSUL_HTTP_TOKEN"); token != "" {
+			req.Header.Set("X-Consul-Token", token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("请求 Consul 服务 %s 失败: %w", service, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("请求 Consul 服务 %s 失败: HTTP 状态 %s", service, resp.Status)
+		}
+		var found []consulEntry
+		err = json.NewDecoder(resp.Body).Decode(&found)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析 Consul 服务 %s 的响应失败: %w", service, err)
+		}
+		if len(found) == 0 {
+			fmt.Fprintf(console, "警告: Consul 服务 %s 没有通过健康检查的实例\n", service)
+		}
+		entries = append(entries, found...)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		return cmp.Or(cmp.Compare(a.Service.Service, b.Service.Service),
+			cmp.Compare(a.Node.Node, b.Node.Node),
+			cmp.Compare(a.Service.ID, b.Service.ID)) < 0
+	})
+	infos := make([]ServerInfo, 0, len(entries))
+	for i, entry := range entries {
+		info := ServerInfo{
+			AppName:    entry.Service.Service,
+			ServerIP:   cmp.Or(entry.Service.Address, entry.Node.Address),
+			ServerID:   i + 1,
+			ServerPort: entry.Service.Port,
+		}
+		if id, err := strconv.Atoi(entry.Service.Meta["serverID"]); err == nil {
+			info.ServerID = id
+		}
+		infos = append(infos, info)
+	}
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("未在 Consul 中找到服务 %s 的健康实例", config.ConsulService)
+	}
+	return infos, nil
+}
@@ -0,0 +1,14 @@
+//go:build idna
+
+// 国际化域名转换，依赖 golang.org/x/net/idna，需以 -tags idna 编译
+
+package main
+
+import "golang.org/x/net/idna"
+
+// idnaProfile 为国际化域名的转换规则：UTS #46 查询映射，并校验空标签与标签长度
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+func init() {
+	idnaToASCII = idnaProfile.ToASCII
+}
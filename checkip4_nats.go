@@ -0,0 +1,185 @@
+//go:build nats
+
+// 发布检查结果到 NATS (-nats-url)，需以 -tags nats 编译
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	newNATSPublisher = func(rawURL, subject string, timeout time.Duration) (Publisher, error) {
+		p, err := dialNATS(rawURL, subject, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	}
+}
+
+// natsPublisher 基于 NATS 文本协议的发布者，不依赖第三方客户端库
+// 消息先写入缓冲，每轮总结及关闭时刷新；关闭时通过 PING/PONG 确认服务端已收到全部消息
+type natsPublisher struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	w       *bufio.Writer
+	subject string
+	timeout time.Duration
+	pong    chan struct{}
+	errMu   sync.Mutex
+	err     error // 服务端返回的 -ERR 或读取连接时的错误
+}
+
+// dialNATS 连接 NATS 服务器并完成 CONNECT 握手
+func dialNATS(rawURL, subject string, timeout time.Duration) (*natsPublisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("无效的 NATS 地址 %q", rawURL)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	if !connSlots.reserve() {
+		return nil, fmt.Errorf("-max-connections-total 名额不足")
+	}
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		connSlots.release()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+
+	// 服务端连接后首先发送 INFO
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	line, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO") {
+		conn.Close()
+		connSlots.release()
+		return nil, fmt.Errorf("未收到 NATS INFO: %v", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "checkip", "version": version}
+	if u.User != nil {
+		options["user"] = u.User.Username()
+		if pass, ok := u.User.Password(); ok {
+			options["pass"] = pass
+		}
+	}
+	connectJSON, _ := json.Marshal(options)
+
+	p := &natsPublisher{
+		conn:    conn,
+		w:       bufio.NewWriterSize(conn, 32<<10),
+		subject: subject,
+		timeout: timeout,
+		pong:    make(chan struct{}, 1),
+	}
+	fmt.Fprintf(p.w, "CONNECT %s\r\n", connectJSON)
+	if err := p.w.Flush(); err != nil {
+		conn.Close()
+		connSlots.release()
+		return nil, err
+	}
+	go p.readLoop(reader)
+	return p, nil
+}
+
+// readLoop 处理服务端的 PING、PONG 与 -ERR
+func (p *natsPublisher) readLoop(reader *bufio.Reader) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			p.setErr(err)
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			p.mu.Lock()
+			p.w.WriteString("PONG\r\n")
+			p.w.Flush()
+			p.mu.Unlock()
+		case line == "PONG":
+			select {
+			case p.pong <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			p.setErr(fmt.Errorf("NATS 服务端错误: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+		}
+	}
+}
+
+func (p *natsPublisher) setErr(err error) {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *natsPublisher) getErr() error {
+	p.errMu.Lock()
+	defer p.errMu.Unlock()
+	return p.err
+}
+
+// publish 将 JSON 消息写入发送缓冲
+func (p *natsPublisher) publish(subject string, v any) error {
+	if err := p.getErr(); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, "PUB %s %d\r\n", subject, len(payload))
+	p.w.Write(payload)
+	_, err = p.w.WriteString("\r\n")
+	return err
+}
+
+func (p *natsPublisher) PublishResult(result CheckResult) error {
+	return p.publish(p.subject, result)
+}
+
+func (p *natsPublisher) PublishSummary(summary Summary) error {
+	if err := p.publish(p.subject+".summary", summary); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.w.Flush()
+}
+
+func (p *natsPublisher) Close() error {
+	defer p.conn.Close()
+
+	p.mu.Lock()
+	p.w.WriteString("PING\r\n")
+	err := p.w.Flush()
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-p.pong:
+		return p.getErr()
+	case <-time.After(p.timeout):
+		return fmt.Errorf("等待 NATS 确认超时")
+	}
+}
@@ -0,0 +1,130 @@
+//go:build sshjump
+
+// 经 SSH 跳板机拨号 (-ssh-jump)，依赖 golang.org/x/crypto/ssh，需以 -tags sshjump 编译:
+//
+//	go build -tags sshjump -o checkip4 .
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	osuser "os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func init() {
+	dialSSHJump = func(spec, keyPath string, timeout time.Duration) (jumpDialer, error) {
+		client, err := dialSSH(spec, keyPath, timeout)
+		if err != nil {
+			return nil, err
+		}
+		return client, nil
+	}
+}
+
+// parseSSHTarget 解析 user@host[:port]，缺省用户为当前登录用户，缺省端口为 22
+func parseSSHTarget(spec string) (user, addr string, err error) {
+	user, host, ok := strings.Cut(spec, "@")
+	if !ok {
+		host = spec
+		u, err := osuser.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("无法确定 SSH 用户名，请使用 user@host 形式: %w", err)
+		}
+		user = u.Username
+	}
+	if host == "" || user == "" {
+		return "", "", fmt.Errorf("无效的 SSH 跳板机 %q (应为 user@host[:port])", spec)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	return user, host, nil
+}
+
+// sshSigners 收集可用的私钥：ssh-agent 中的全部私钥，以及指定的私钥文件 (未指定时尝试 ~/.ssh 下的默认私钥)
+func sshSigners(keyPath string) ([]ssh.Signer, error) {
+	var signers []ssh.Signer
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentSigners, err := agent.NewClient(conn).Signers()
+			conn.Close()
+			if err == nil {
+				signers = append(signers, agentSigners...)
+			}
+		}
+	}
+
+	keyPaths := []string{keyPath}
+	if keyPath == "" {
+		keyPaths = nil
+		if home, err := os.UserHomeDir(); err == nil {
+			for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+				keyPaths = append(keyPaths, filepath.Join(home, ".ssh", name))
+			}
+		}
+	}
+	for _, path := range keyPaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if keyPath == "" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("读取 SSH 私钥失败 %s: %w", path, err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			var missing *ssh.PassphraseMissingError
+			if keyPath == "" && errors.As(err, &missing) {
+				continue // 加密的默认私钥交由 ssh-agent 处理
+			}
+			return nil, fmt.Errorf("解析 SSH 私钥失败 %s: %w", path, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	if len(signers) == 0 {
+		return nil, errors.New("没有可用的 SSH 私钥 (请启动 ssh-agent 或使用 -ssh-key 指定)")
+	}
+	return signers, nil
+}
+
+// dialSSH 连接 SSH 跳板机，主机密钥按 ~/.ssh/known_hosts 校验
+func dialSSH(spec, keyPath string, timeout time.Duration) (*ssh.Client, error) {
+	user, addr, err := parseSSHTarget(spec)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := sshSigners(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("无法定位 known_hosts: %w", err)
+	}
+	hostKeyCallback, err := knownhosts.New(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		return nil, fmt.Errorf("读取 known_hosts 失败: %w", err)
+	}
+
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signers...)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("连接 SSH 跳板机 %s 失败: %w", addr, err)
+	}
+	return client, nil
+}
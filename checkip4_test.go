@@ -0,0 +1,749 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "以本次输出重写 testdata 下的 golden 文件")
+
+// stubLookupIP 在测试期间以固定的解析函数替换 lookupIP，测试结束后恢复
+func stubLookupIP(t *testing.T, lookup func(ctx context.Context, host string) ([]net.IP, error)) {
+	t.Helper()
+	saved := lookupIP
+	lookupIP = lookup
+	t.Cleanup(func() { lookupIP = saved })
+}
+
+func TestCheckEmptyDNSAnswer(t *testing.T) {
+	stubLookupIP(t, func(ctx context.Context, host string) ([]net.IP, error) {
+		return nil, nil
+	})
+
+	tests := []struct {
+		name   string
+		info   ServerInfo
+		config func(*Config)
+	}{
+		{"tcp", ServerInfo{AppName: "web", ServerIP: "empty.example", ServerID: 1, ServerPort: 443}, nil},
+		{"dns", ServerInfo{AppName: "web", ServerIP: "empty.example", ServerID: 2, CheckType: checkDNS}, nil},
+		{"probe-all-ips", ServerInfo{AppName: "web", ServerIP: "empty.example", ServerID: 3, ServerPort: 443},
+			func(c *Config) { c.ProbeAllIPs = true }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+			result := checkConnectivity(context.Background(), tt.info, config)
+			if result.IsSuccess {
+				t.Fatal("空的 DNS 结果被判定为成功")
+			}
+			if result.Error != "DNS返回空结果" {
+				t.Errorf("Error = %q, 期望 %q", result.Error, "DNS返回空结果")
+			}
+			if result.ErrorClass != errorDNS {
+				t.Errorf("ErrorClass = %q, 期望 %q", result.ErrorClass, errorDNS)
+			}
+		})
+	}
+}
+
+// TestProbeAllIPsSlowConnect 两个地址中只有第二个连接慢，合并结果应按最慢的地址判定为连接慢
+func TestProbeAllIPsSlowConnect(t *testing.T) {
+	stubLookupIP(t, func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}, nil
+	})
+	saved := tcpDial
+	t.Cleanup(func() { tcpDial = saved })
+	const slow = 30 * time.Millisecond
+	tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+		if hostOf(address) == "10.0.0.2" {
+			time.Sleep(slow)
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	config := DefaultConfig()
+	config.ProbeAllIPs = true
+	config.SlowConnect = slow * 2 / 3
+	info := ServerInfo{AppName: "web", ServerIP: "rr.example", ServerID: 1, ServerPort: 443}
+	result := checkConnectivity(context.Background(), info, config)
+	if !result.IsSuccess {
+		t.Fatalf("检查失败: %s", result.Error)
+	}
+	if len(result.IPResults) != 2 {
+		t.Fatalf("IPResults 有 %d 项，期望 2 项", len(result.IPResults))
+	}
+	if !result.SlowConnect || result.Status != statusDegraded {
+		t.Errorf("SlowConnect = %v, Status = %q，期望第二个地址连接慢使结果为 %q", result.SlowConnect, result.Status, statusDegraded)
+	}
+	if result.ConnectTime < slow {
+		t.Errorf("ConnectTime = %v，期望取最慢地址的连接耗时 (不少于 %v)", result.ConnectTime, slow)
+	}
+	if result.Retries != 0 {
+		t.Errorf("Retries = %d，两个地址都一次成功，期望 0", result.Retries)
+	}
+}
+
+// stubDial 在测试期间以假拨号器替换 tcpDial：每次拨号等待 delay 后返回一端已关闭的内存连接
+func stubDial(t testing.TB, delay time.Duration) {
+	t.Helper()
+	saved := tcpDial
+	tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	t.Cleanup(func() { tcpDial = saved })
+}
+
+// benchmarkResults 以假拨号器检查一批服务器，消费方每条结果耗时 consume，比较不同结果缓冲下的吞吐
+func benchmarkResults(b *testing.B, resultBuffer int) {
+	stubDial(b, time.Millisecond)
+	infos := make([]ServerInfo, 200)
+	for i := range infos {
+		infos[i] = ServerInfo{AppName: "bench", ServerIP: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1), ServerID: i + 1, ServerPort: 80}
+	}
+	config := DefaultConfig()
+	config.ConcurrentLimit = 20
+	config.ResultBuffer = resultBuffer
+	ctx := context.Background()
+	probe := func(info ServerInfo) CheckResult { return checkConnectivity(ctx, info, config) }
+	const consume = 50 * time.Microsecond
+
+	for b.Loop() {
+		checkBatch(ctx, infos, config, nil, 1, probe, func(result CheckResult) {
+			if !result.IsSuccess {
+				b.Fatalf("假拨号器的检查失败: %s", result.Error)
+			}
+			// 忙等模拟写输出的耗时 (time.Sleep 的精度不足以表示微秒级耗时)
+			for start := time.Now(); time.Since(start) < consume; {
+			}
+		})
+	}
+}
+
+// BenchmarkResultsBuffered 使用默认缓冲 (按服务器数量)，检查不受输出速度影响
+func BenchmarkResultsBuffered(b *testing.B) { benchmarkResults(b, 0) }
+
+// BenchmarkResultsUnbuffered 使用最小缓冲 (-result-buffer 1)，输出跟不上时检查被背压限速
+func BenchmarkResultsUnbuffered(b *testing.B) { benchmarkResults(b, 1) }
+
+// TestDNSCacheFailover 模拟 DNS 切换：TTL 内继续拨号缓存的旧 IP，TTL (含抖动) 过后拨号新 IP
+func TestDNSCacheFailover(t *testing.T) {
+	const ttl = time.Minute
+	current := net.ParseIP("10.0.0.1")
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	cache := newDNSCache(ttl)
+	cache.lookup = func(ctx context.Context, host string) ([]net.IP, error) {
+		return []net.IP{current}, nil
+	}
+	cache.now = func() time.Time { return now }
+
+	var dialed []string
+	savedResolver, savedDial := resolver, tcpDial
+	t.Cleanup(func() { resolver, tcpDial = savedResolver, savedDial })
+	resolver = cache
+	tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+		dialed = append(dialed, address)
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	info := ServerInfo{AppName: "web", ServerIP: "failover.example", ServerID: 1, ServerPort: 80}
+	config := DefaultConfig()
+	config.DNSTTL = ttl
+	check := func() {
+		t.Helper()
+		if result := checkConnectivity(context.Background(), info, config); !result.IsSuccess {
+			t.Fatalf("检查失败: %s", result.Error)
+		}
+	}
+
+	check()
+	current = net.ParseIP("10.0.0.2") // DNS 切换到新的地址
+	now = now.Add(ttl * 8 / 10)       // 早于最短的过期时间 (TTL -10%)
+	check()
+	now = now.Add(ttl * 4 / 10) // 晚于最长的过期时间 (TTL +10%)
+	check()
+
+	want := []string{"10.0.0.1:80", "10.0.0.1:80", "10.0.0.2:80"}
+	if !slices.Equal(dialed, want) {
+		t.Errorf("拨号地址 %v，期望 %v", dialed, want)
+	}
+}
+
+// writeConf 将配置内容写入临时目录下的 .conf 文件并返回路径
+func writeConf(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "servers.conf")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseServerInfoCRLFAndBOM(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"LF", "appName: web\nserverIP: www.example.com\nserverID: 7\nserverPort: 443\n"},
+		{"CRLF", "appName: web\r\nserverIP: www.example.com\r\nserverID: 7\r\nserverPort: 443\r\n"},
+		{"BOM+CRLF", utf8BOM + "appName: web\r\nserverIP: www.example.com\r\nserverID: 7\r\nserverPort: 443\r\n"},
+		{"BOM+CRLF 首行注释", utf8BOM + "# 应用\r\nappName: \"web\"\r\nserverIP: \"www.example.com\"\r\nserverID: 7\r\nserverPort: 443"},
+	}
+	want := ServerInfo{AppName: "web", ServerIP: "www.example.com", ServerID: 7, ServerPort: 443}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &parseStats{Unknown: map[string]int{}}
+			infos, err := parseServerInfo(writeConf(t, tt.content), stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != 1 {
+				t.Fatalf("解析出 %d 个服务器，期望 1 个", len(infos))
+			}
+			got := infos[0]
+			if got.AppName != want.AppName || got.ServerIP != want.ServerIP || got.ServerID != want.ServerID || got.ServerPort != want.ServerPort {
+				t.Errorf("解析结果 %+v，期望 %+v", got, want)
+			}
+			if len(stats.Unknown) > 0 {
+				t.Errorf("出现未识别的键 %v (BOM 混入了键名?)", stats.Unknown)
+			}
+		})
+	}
+}
+
+func TestParseServerInfoKeyCase(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"驼峰", "appName: web\nserverIP: 10.0.0.1\nserverID: 3\ncheckType: tcp\nserverPort: 80\n"},
+		{"首字母大写", "AppName: web\nServerIP: 10.0.0.1\nServerID: 3\nCheckType: tcp\nServerPort: 80\n"},
+		{"全小写", "appname: web\nserverip: 10.0.0.1\nserverid: 3\nchecktype: tcp\nserverport: 80\n"},
+		{"全大写", "APPNAME: web\nSERVERIP: 10.0.0.1\nSERVERID: 3\nCHECKTYPE: tcp\nSERVERPORT: 80\n"},
+		{"混合", "aPpNaMe: web\nServerip: 10.0.0.1\nserverId: 3\nCheckTYPE: tcp\nSERVERport: 80\n"},
+	}
+	want := ServerInfo{AppName: "web", ServerIP: "10.0.0.1", ServerID: 3, CheckType: checkTCP, ServerPort: 80}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			infos, err := parseServerInfo(writeConf(t, tt.content), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(infos) != 1 {
+				t.Fatalf("解析出 %d 个服务器，期望 1 个", len(infos))
+			}
+			got := infos[0]
+			if got.AppName != want.AppName || got.ServerIP != want.ServerIP || got.ServerID != want.ServerID ||
+				got.CheckType != want.CheckType || got.ServerPort != want.ServerPort {
+				t.Errorf("解析结果 %+v，期望 %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseServerInfoSeparators(t *testing.T) {
+	content := `# 冒号与等号两种写法混用
+appName: web
+serverIP: 10.0.0.1
+serverID: 1
+serverPort: 80
+
+appName=api
+serverIP=fe80::1
+serverID=2
+path=/healthz?probe=1
+serverPort=8080
+
+appName = db
+serverIP: "2001:db8::5"
+serverID = 3
+serverPort: 5432
+`
+	want := []ServerInfo{
+		{AppName: "web", ServerIP: "10.0.0.1", ServerID: 1, ServerPort: 80},
+		{AppName: "api", ServerIP: "fe80::1", ServerID: 2, Path: "/healthz?probe=1", ServerPort: 8080},
+		{AppName: "db", ServerIP: "2001:db8::5", ServerID: 3, ServerPort: 5432},
+	}
+	stats := &parseStats{Unknown: map[string]int{}}
+	infos, err := parseServerInfo(writeConf(t, content), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("解析出 %d 个服务器，期望 %d 个", len(infos), len(want))
+	}
+	for i, got := range infos {
+		w := want[i]
+		if got.AppName != w.AppName || got.ServerIP != w.ServerIP || got.ServerID != w.ServerID ||
+			got.Path != w.Path || got.ServerPort != w.ServerPort {
+			t.Errorf("第 %d 个服务器 %+v，期望 %+v", i+1, got, w)
+		}
+	}
+	if len(stats.Malformed) > 0 || len(stats.Unknown) > 0 {
+		t.Errorf("解析诊断: 格式错误的行 %v，未识别的键 %v", stats.Malformed, stats.Unknown)
+	}
+}
+
+func TestGzipFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "connectinfo.log.gz")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := newGzipFile(file)
+	first := "[2024-05-01 08:30:00] 服务器ID: 1, 应用: web, 状态: 成功\n"
+	second := "检查完成！\n总计: 1\n"
+
+	if _, err := io.WriteString(gz, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Flush 之后文件尚未写入 gzip 尾部，但已写入的内容应能解压出来
+	if got := gunzip(t, path, true); got != first {
+		t.Errorf("Flush 后解压得到 %q，期望 %q", got, first)
+	}
+
+	if _, err := io.WriteString(gz, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := gunzip(t, path, false); got != first+second {
+		t.Errorf("Close 后解压得到 %q，期望 %q", got, first+second)
+	}
+}
+
+// gunzip 解压文件内容；partial 为 true 时允许缺少 gzip 尾部 (文件仍在写入)
+func gunzip(t *testing.T, path string, partial bool) string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("不是有效的 gzip 文件: %v", err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil && !(partial && errors.Is(err, io.ErrUnexpectedEOF)) {
+		t.Fatalf("解压失败: %v", err)
+	}
+	return string(data)
+}
+
+func TestRotatingWriter(t *testing.T) {
+	const header = "# 日志头\n"
+	name := filepath.Join(t.TempDir(), "connectinfo.log")
+	w, err := newRotatingWriter(name, 64, 2, func(w io.Writer) { io.WriteString(w, header) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for i := range 10 {
+		line := fmt.Sprintf("结果 %02d: 0123456789\n", i)
+		lines = append(lines, line)
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 最多保留 2 个历史文件：最旧的 name.2、name.1，再到当前的 name，内容依次衔接
+	var records []string
+	for _, path := range []string{name + ".2", name + ".1", name} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(data)
+		if len(content) > 64 {
+			t.Errorf("%s 大小 %d 超过上限 64", filepath.Base(path), len(content))
+		}
+		body, ok := strings.CutPrefix(content, header)
+		if !ok {
+			t.Errorf("%s 开头缺少日志头: %q", filepath.Base(path), content)
+		}
+		records = append(records, body)
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("保留了超出 -log-max-files 的历史文件 %s.3", filepath.Base(name))
+	}
+	kept := strings.Join(records, "")
+	if want := strings.Join(lines, ""); !strings.HasSuffix(want, kept) || kept == "" {
+		t.Errorf("轮转后保留的内容 %q 不是写入内容的末尾部分", kept)
+	}
+}
+
+// benchmarkTightCount 以类似 -count 的紧凑循环反复检查本机同一端口，每次连接由本端先关闭，
+// 本端的临时端口随之进入 TIME_WAIT；报告每次检查的失败率 (failures/op)
+func benchmarkTightCount(b *testing.B, reusePort bool) {
+	if _, ok := soReusePort(); reusePort && !ok {
+		b.Skip("当前系统不支持 SO_REUSEPORT")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	info := ServerInfo{AppName: "bench", ServerIP: "127.0.0.1", ServerID: 1, ServerPort: ln.Addr().(*net.TCPAddr).Port}
+	config := DefaultConfig()
+	config.ReusePort = reusePort
+	config.RetryCount = 1
+	ctx := context.Background()
+	checks, failures := 0, 0
+	for b.Loop() {
+		checks++
+		if result := checkConnectivity(ctx, info, config); !result.IsSuccess {
+			failures++
+		}
+	}
+	b.ReportMetric(float64(failures)/float64(checks), "failures/op")
+}
+
+func BenchmarkTightCount(b *testing.B) { benchmarkTightCount(b, false) }
+
+func BenchmarkTightCountReusePort(b *testing.B) { benchmarkTightCount(b, true) }
+
+// inflightRecorder 替换 tcpDial，按 key(拨号地址) 分组记录同时进行的拨号数及其峰值
+type inflightRecorder struct {
+	mu      sync.Mutex
+	current map[string]int
+	peak    map[string]int
+	total   int // 所有分组合计的当前值
+	maxAll  int // 所有分组合计的峰值
+
+	// 拨号停在屏障处，直到合计同时拨号数达到 hold 后一起放行，
+	// 各分组是否同时进行拨号因此不依赖调度时机
+	hold     int
+	arrived  chan struct{}
+	released bool
+}
+
+// holdTimeout 为屏障等待的上限，限流有误而无法达到 hold 时测试失败而不是挂起
+const holdTimeout = 5 * time.Second
+
+func recordInflight(t *testing.T, hold int, key func(address string) string) *inflightRecorder {
+	t.Helper()
+	r := &inflightRecorder{current: map[string]int{}, peak: map[string]int{}, hold: hold, arrived: make(chan struct{})}
+	saved := tcpDial
+	t.Cleanup(func() { tcpDial = saved })
+	tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+		k := key(address)
+		r.mu.Lock()
+		r.current[k]++
+		r.total++
+		r.peak[k] = max(r.peak[k], r.current[k])
+		r.maxAll = max(r.maxAll, r.total)
+		if r.total >= r.hold && !r.released {
+			close(r.arrived)
+			r.released = true
+		}
+		r.mu.Unlock()
+		select {
+		case <-r.arrived:
+		case <-time.After(holdTimeout):
+		}
+		r.mu.Lock()
+		r.current[k]--
+		r.total--
+		r.mu.Unlock()
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	return r
+}
+
+// hostOf 返回拨号地址中的主机部分
+func hostOf(address string) string {
+	host, _, _ := net.SplitHostPort(address)
+	return host
+}
+
+func TestPerHostConcurrency(t *testing.T) {
+	const perHost = 2
+	savedSlots := hostSlots
+	t.Cleanup(func() { hostSlots = savedSlots })
+	hostSlots = newHostLimiter(perHost)
+	recorder := recordInflight(t, 2*perHost, hostOf) // 两个主机各占满名额后才放行
+
+	var infos []ServerInfo
+	for i := range 10 {
+		infos = append(infos,
+			ServerInfo{AppName: "a", ServerIP: "10.0.0.1", ServerID: 1, ServerPort: 8000 + i},
+			ServerInfo{AppName: "b", ServerIP: "10.0.0.2", ServerID: 2, ServerPort: 8000 + i})
+	}
+	config := DefaultConfig()
+	config.ConcurrentLimit = 20
+	config.PerHostConcurrency = perHost
+	ctx := context.Background()
+	checked := 0
+	checkBatch(ctx, infos, config, nil, 1, func(info ServerInfo) CheckResult {
+		return checkConnectivity(ctx, info, config)
+	}, func(result CheckResult) {
+		checked++
+		if !result.IsSuccess {
+			t.Errorf("%s:%d 检查失败: %s", result.ServerInfo.ServerIP, result.ServerInfo.ServerPort, result.Error)
+		}
+	})
+
+	if checked != len(infos) {
+		t.Fatalf("收到 %d 个结果，期望 %d 个", checked, len(infos))
+	}
+	for _, host := range []string{"10.0.0.1", "10.0.0.2"} {
+		if peak := recorder.peak[host]; peak > perHost {
+			t.Errorf("%s 同时拨号峰值 %d，超过 -per-host-concurrency %d", host, peak, perHost)
+		}
+	}
+	// 两个主机各自计数，合计可以超过单个主机的上限
+	if recorder.maxAll <= perHost {
+		t.Errorf("合计同时拨号峰值 %d，不同主机之间不应共用名额", recorder.maxAll)
+	}
+}
+
+// TestSequentialGolden 在固定的时钟、运行ID 与假拨号器下以 -sequential 检查一轮，
+// 标准输出与日志须与 testdata/sequential.golden 逐字节相同 (go test -update 重写)
+func TestSequentialGolden(t *testing.T) {
+	fixed := time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)
+	savedClock, savedConsole, savedDial := clock, console, tcpDial
+	t.Cleanup(func() { clock, console, tcpDial = savedClock, savedConsole, savedDial })
+	clock = func() time.Time { return fixed }
+	tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+		if strings.HasSuffix(address, ":81") {
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	infos := []ServerInfo{
+		{AppName: "cache", ServerIP: "10.0.0.3", ServerID: 3, ServerPort: 6379},
+		{AppName: "web", ServerIP: "10.0.0.1", ServerID: 1, ServerPort: 81},
+		{AppName: "web", ServerIP: "10.0.0.1", ServerID: 1, ServerPort: 80},
+		{AppName: "db", ServerIP: "10.0.0.2", ServerID: 2, ServerPort: 5432},
+	}
+	config := DefaultConfig()
+	config.Sequential = true
+	config.RunID = "golden-run"
+	config.RetryCount = 1
+
+	run := func() string {
+		var stdout, log bytes.Buffer
+		console = &stdout
+		runCycle(context.Background(), infos, config, &runState{logFile: &log, logFileName: "connectinfo_golden.log"})
+		return "== 标准输出 ==\n" + stdout.String() + "== 日志文件 ==\n" + log.String()
+	}
+	got := run()
+	if again := run(); again != got {
+		t.Fatalf("两次运行的输出不同:\n%s\n---\n%s", got, again)
+	}
+
+	golden := filepath.Join("testdata", "sequential.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("输出与 %s 不同:\n%s", golden, got)
+	}
+}
+
+func TestPerSubnetConcurrency(t *testing.T) {
+	const perSubnet = 2
+	savedSlots, savedPrefix := subnetSlots, subnetPrefix
+	t.Cleanup(func() { subnetSlots, subnetPrefix = savedSlots, savedPrefix })
+	subnetSlots, subnetPrefix = newHostLimiter(perSubnet), 24
+	// 两个网段各占满名额后才放行
+	recorder := recordInflight(t, 2*perSubnet, func(address string) string {
+		return subnetKey(hostOf(address), 24)
+	})
+
+	// 两个 /24 网段，每个网段内有多个主机，同一网段的不同主机共用名额
+	var infos []ServerInfo
+	for i := range 8 {
+		infos = append(infos,
+			ServerInfo{AppName: "a", ServerIP: fmt.Sprintf("192.168.1.%d", i+1), ServerID: i + 1, ServerPort: 80},
+			ServerInfo{AppName: "b", ServerIP: fmt.Sprintf("192.168.2.%d", i+1), ServerID: i + 101, ServerPort: 80})
+	}
+	config := DefaultConfig()
+	config.ConcurrentLimit = 16
+	config.PerSubnetConcurrency = perSubnet
+	ctx := context.Background()
+	checked := 0
+	checkBatch(ctx, infos, config, nil, 1, func(info ServerInfo) CheckResult {
+		return checkConnectivity(ctx, info, config)
+	}, func(result CheckResult) {
+		checked++
+		if !result.IsSuccess {
+			t.Errorf("%s 检查失败: %s", result.ServerInfo.ServerIP, result.Error)
+		}
+	})
+
+	if checked != len(infos) {
+		t.Fatalf("收到 %d 个结果，期望 %d 个", checked, len(infos))
+	}
+	for _, subnet := range []string{"192.168.1.0/24", "192.168.2.0/24"} {
+		if peak := recorder.peak[subnet]; peak > perSubnet {
+			t.Errorf("%s 同时拨号峰值 %d，超过 -per-subnet-concurrency %d", subnet, peak, perSubnet)
+		}
+	}
+	if recorder.maxAll <= perSubnet {
+		t.Errorf("合计同时拨号峰值 %d，不同网段之间不应共用名额", recorder.maxAll)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		delay  time.Duration
+		jitter bool
+	}{
+		{"固定", time.Second, false},
+		{"抖动", time.Second, true},
+		{"抖动 毫秒级", 3 * time.Millisecond, true},
+		{"关闭等待", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.RetryDelay, config.RetryJitter = tt.delay, tt.jitter
+			const samples = 2000
+			seen := map[time.Duration]bool{}
+			var sum time.Duration
+			for range samples {
+				d := retryDelay(config)
+				if d < 0 || d > tt.delay {
+					t.Fatalf("等待时间 %v 超出 [0, %v]", d, tt.delay)
+				}
+				if !tt.jitter && d != tt.delay {
+					t.Fatalf("未开启 -retry-jitter 时等待时间 %v，期望固定为 %v", d, tt.delay)
+				}
+				seen[d] = true
+				sum += d
+			}
+			if !tt.jitter || tt.delay == 0 {
+				return
+			}
+			// full jitter 在整个区间内均匀分布：取值分散，平均值接近区间中点
+			if len(seen) < 2 {
+				t.Errorf("%d 次取样只出现 %d 个不同的等待时间", samples, len(seen))
+			}
+			if mean := sum / samples; mean < tt.delay*4/10 || mean > tt.delay*6/10 {
+				t.Errorf("平均等待时间 %v，期望接近 %v", mean, tt.delay/2)
+			}
+		})
+	}
+}
+
+// TestStdoutLogOrdering 并发检查的同时由后台 goroutine 写入恢复监视的提示，
+// 标准输出与日志文件中的结果记录、提示与总结应逐字节一致且顺序相同：
+// 日志中的提示以 "# " 开头，标准输出多出 "开始检查" 一行，除此之外两边相同
+func TestStdoutLogOrdering(t *testing.T) {
+	savedConsole, savedDial := console, tcpDial
+	t.Cleanup(func() { console, tcpDial = savedConsole, savedDial })
+
+	var infos []ServerInfo
+	for i := range 30 {
+		infos = append(infos, ServerInfo{AppName: fmt.Sprintf("app%02d", i), ServerIP: fmt.Sprintf("10.0.1.%d", i+1), ServerID: i + 1, ServerPort: 80 + i%3})
+	}
+
+	for _, output := range []string{outputText, outputJSON, outputTable, outputMarkdown} {
+		t.Run(output, func(t *testing.T) {
+			var stdout, log bytes.Buffer
+			console = &stdout
+			watcher := &recoveryWatcher{logFile: &log}
+
+			// 首次拨号时 ("开始检查" 已写出) 启动后台提示，与结果输出交错
+			var notes sync.WaitGroup
+			var once sync.Once
+			tcpDial = func(ctx context.Context, dialer *net.Dialer, address string) (net.Conn, error) {
+				once.Do(func() {
+					notes.Add(1)
+					go func() {
+						defer notes.Done()
+						for i := range 20 {
+							watcher.report(fmt.Sprintf("已恢复: 提示 %d", i))
+							time.Sleep(100 * time.Microsecond)
+						}
+					}()
+				})
+				time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+				if strings.HasSuffix(address, ":81") {
+					return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+				}
+				client, server := net.Pipe()
+				server.Close()
+				return client, nil
+			}
+
+			config := DefaultConfig()
+			config.ConcurrentLimit = 8
+			config.RetryCount = 1
+			config.RunID = "ordering"
+			config.Output, config.LogOutput = output, output
+			runCycle(context.Background(), infos, config, &runState{logFile: &log, logFileName: "connectinfo_ordering.log"})
+			notes.Wait()
+
+			gotStdout, ok := strings.CutPrefix(stdout.String(), "开始检查 30 个服务器的连通性...\n")
+			if !ok {
+				t.Fatalf("标准输出缺少开始提示:\n%s", stdout.String())
+			}
+			gotLog := strings.ReplaceAll(log.String(), "# 已恢复: ", "已恢复: ")
+			if gotStdout != gotLog {
+				t.Fatalf("标准输出与日志文件的内容或顺序不同\n== 标准输出 ==\n%s\n== 日志文件 ==\n%s", gotStdout, gotLog)
+			}
+			if n := strings.Count(gotLog, "已恢复: 提示"); n != 20 {
+				t.Errorf("日志中有 %d 条提示，期望 20 条", n)
+			}
+		})
+	}
+}